@@ -0,0 +1,126 @@
+package pgmigrate
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DB is the interface Migrator uses to talk to Postgres for the duration
+// of one session. It is always backed by a single physical connection
+// pinned for that session (a *sql.Conn for NewMigrator's postgres://,
+// postgresql:// and pgx:// urls and for NewMigratorWithDB, a *pgxpool.Conn for the
+// driver/pgx subpackage), so that session-scoped state such as the
+// advisory lock Migrator holds is always acquired and released on the
+// same connection, even when the *sql.DB/*pgxpool.Pool it was acquired
+// from is a pool used concurrently elsewhere. Close releases the
+// connection back to wherever it was acquired from.
+type DB interface {
+	Exec(ctx context.Context, query string, args ...interface{}) error
+	QueryRow(ctx context.Context, query string, args ...interface{}) Row
+	Query(ctx context.Context, query string, args ...interface{}) (Rows, error)
+	Begin(ctx context.Context) (Tx, error)
+	Close() error
+}
+
+// Row is the result of a QueryRow call. It is satisfied directly by
+// *sql.Row; the driver/pgx subpackage adapts pgx.Row to the same shape,
+// normalizing pgx.ErrNoRows to sql.ErrNoRows so callers only need to
+// check one sentinel.
+type Row interface {
+	Scan(dest ...interface{}) error
+}
+
+// Rows iterates over the results of a Query call. It is satisfied
+// directly by *sql.Rows; the driver/pgx subpackage adapts pgx.Rows to
+// the same shape.
+type Rows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+	Close() error
+}
+
+// Tx represents an in-flight transaction started by Begin.
+type Tx interface {
+	Exec(ctx context.Context, query string, args ...interface{}) error
+	Query(ctx context.Context, query string, args ...interface{}) (Rows, error)
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
+
+// sqlConn adapts a *sql.Conn (lib/pq via the driver/pq subpackage, pgx's
+// own database/sql driver, or any other database/sql driver) to DB. A
+// *sql.Conn is pinned to a single physical connection for as long as it's
+// open, unlike *sql.DB itself, which hands out whichever connection is
+// free on each call; pinning matters here because the advisory lock
+// Migrator takes for the duration of a session is scoped to the Postgres
+// session behind one physical connection, and must be acquired and
+// released on that same connection. Close releases the connection back
+// to the *sql.DB it came from.
+type sqlConn struct {
+	conn *sql.Conn
+}
+
+func (a *sqlConn) Exec(ctx context.Context, query string, args ...interface{}) error {
+	_, err := a.conn.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (a *sqlConn) QueryRow(ctx context.Context, query string, args ...interface{}) Row {
+	return a.conn.QueryRowContext(ctx, query, args...)
+}
+
+func (a *sqlConn) Query(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	return a.conn.QueryContext(ctx, query, args...)
+}
+
+func (a *sqlConn) Begin(ctx context.Context) (Tx, error) {
+	tx, err := a.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{tx}, nil
+}
+
+func (a *sqlConn) Close() error {
+	return a.conn.Close()
+}
+
+// ownedSQLDB wraps a sqlConn pinned from a *sql.DB that the Migrator
+// opened itself (see NewMigrator), closing that *sql.DB too once the
+// connection is released, since nothing else will use it again.
+type ownedSQLDB struct {
+	sqlConn
+	db *sql.DB
+}
+
+func (a *ownedSQLDB) Close() error {
+	connErr := a.sqlConn.Close()
+	dbErr := a.db.Close()
+	if connErr != nil {
+		return connErr
+	}
+	return dbErr
+}
+
+// sqlTx adapts a *sql.Tx to Tx.
+type sqlTx struct {
+	tx *sql.Tx
+}
+
+func (t *sqlTx) Exec(ctx context.Context, query string, args ...interface{}) error {
+	_, err := t.tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (t *sqlTx) Query(ctx context.Context, query string, args ...interface{}) (Rows, error) {
+	return t.tx.QueryContext(ctx, query, args...)
+}
+
+func (t *sqlTx) Commit(ctx context.Context) error {
+	return t.tx.Commit()
+}
+
+func (t *sqlTx) Rollback(ctx context.Context) error {
+	return t.tx.Rollback()
+}
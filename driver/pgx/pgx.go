@@ -0,0 +1,160 @@
+// Package pgx adapts github.com/jackc/pgx/v5's native *pgxpool.Pool to
+// pgmigrate.Migrator, for applications that want pgx's own pooling, TLS,
+// and tracing instead of going through database/sql.
+//
+// pgmigrate itself no longer imports pgx so that applications using
+// lib/pq or pgx's database/sql driver exclusively aren't forced to link
+// in pgx's native client too; import this package wherever you construct
+// a Migrator around a *pgxpool.Pool:
+//
+//	import "github.com/jcoene/pgmigrate/driver/pgx"
+package pgx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jcoene/pgmigrate"
+)
+
+// NewMigrator creates a new Migrator that connects to connString with a
+// native pgx pool, opening and closing a dedicated *pgxpool.Pool for
+// every session.
+func NewMigrator(connString string) *pgmigrate.Migrator {
+	return pgmigrate.NewMigratorWithConnFunc(func(ctx context.Context) (pgmigrate.DB, error) {
+		pool, err := pgxpool.New(ctx, connString)
+		if err != nil {
+			return nil, err
+		}
+		c, err := pool.Acquire(ctx)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		return &ownedPool{conn{c}, pool}, nil
+	})
+}
+
+// NewMigratorWithPool creates a new Migrator around an existing
+// *pgxpool.Pool. The Migrator does not close pool; each session acquires
+// a single connection from it for as long as the session lasts and
+// releases it back to pool afterwards.
+func NewMigratorWithPool(pool *pgxpool.Pool) *pgmigrate.Migrator {
+	return pgmigrate.NewMigratorWithConnFunc(func(ctx context.Context) (pgmigrate.DB, error) {
+		c, err := pool.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &conn{c}, nil
+	})
+}
+
+// conn adapts a *pgxpool.Conn, acquired and pinned for the duration of a
+// session, to pgmigrate.DB. Pinning a single connection for the whole
+// session matters because the advisory lock Migrator holds is scoped to
+// the Postgres session behind one physical connection, and must be
+// acquired and released on that same connection rather than whichever
+// one the pool hands out for each call. Close releases the connection
+// back to the pool it was acquired from.
+type conn struct {
+	c *pgxpool.Conn
+}
+
+func (a *conn) Exec(ctx context.Context, query string, args ...interface{}) error {
+	_, err := a.c.Exec(ctx, query, args...)
+	return err
+}
+
+func (a *conn) QueryRow(ctx context.Context, query string, args ...interface{}) pgmigrate.Row {
+	return &row{a.c.QueryRow(ctx, query, args...)}
+}
+
+func (a *conn) Query(ctx context.Context, query string, args ...interface{}) (pgmigrate.Rows, error) {
+	r, err := a.c.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{r}, nil
+}
+
+func (a *conn) Begin(ctx context.Context) (pgmigrate.Tx, error) {
+	tx, err := a.c.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &txAdapter{tx}, nil
+}
+
+func (a *conn) Close() error {
+	a.c.Release()
+	return nil
+}
+
+// ownedPool wraps a conn pinned from a *pgxpool.Pool that the Migrator
+// opened itself (see NewMigrator), closing that pool too once the
+// connection is released, since nothing else will use it again.
+type ownedPool struct {
+	conn
+	pool *pgxpool.Pool
+}
+
+func (a *ownedPool) Close() error {
+	a.conn.Close()
+	a.pool.Close()
+	return nil
+}
+
+// row adapts pgx.Row to pgmigrate.Row, translating pgx.ErrNoRows to
+// sql.ErrNoRows so callers can check for "no rows" with a single
+// sentinel regardless of which backend a Migrator was built with.
+type row struct {
+	row pgx.Row
+}
+
+func (r *row) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sql.ErrNoRows
+	}
+	return err
+}
+
+// rows adapts pgx.Rows to pgmigrate.Rows; pgx.Rows.Close takes no error,
+// so we always report nil.
+type rows struct {
+	rows pgx.Rows
+}
+
+func (r *rows) Next() bool                     { return r.rows.Next() }
+func (r *rows) Scan(dest ...interface{}) error { return r.rows.Scan(dest...) }
+func (r *rows) Err() error                     { return r.rows.Err() }
+func (r *rows) Close() error                   { r.rows.Close(); return nil }
+
+// txAdapter adapts pgx.Tx to pgmigrate.Tx.
+type txAdapter struct {
+	tx pgx.Tx
+}
+
+func (t *txAdapter) Exec(ctx context.Context, query string, args ...interface{}) error {
+	_, err := t.tx.Exec(ctx, query, args...)
+	return err
+}
+
+func (t *txAdapter) Query(ctx context.Context, query string, args ...interface{}) (pgmigrate.Rows, error) {
+	r, err := t.tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{r}, nil
+}
+
+func (t *txAdapter) Commit(ctx context.Context) error {
+	return t.tx.Commit(ctx)
+}
+
+func (t *txAdapter) Rollback(ctx context.Context) error {
+	return t.tx.Rollback(ctx)
+}
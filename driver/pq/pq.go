@@ -0,0 +1,14 @@
+// Package pq registers lib/pq as the database/sql driver named "postgres",
+// which pgmigrate.NewMigrator uses for postgres:// and postgresql:// urls.
+//
+// pgmigrate no longer imports lib/pq itself so that applications using
+// pgx exclusively aren't forced to link it in; import this package for
+// its side effect wherever you construct a Migrator against a
+// postgres://-style url:
+//
+//	import _ "github.com/jcoene/pgmigrate/driver/pq"
+package pq
+
+import (
+	_ "github.com/lib/pq"
+)
@@ -0,0 +1,124 @@
+package pgmigrate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFileRe matches filenames of the form NNN_name.up.sql or
+// NNN_name.down.sql.
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// LoadDir discovers migration files in the given directory on disk and
+// adds them to the Migrator. It is a convenience wrapper around LoadFS
+// using os.DirFS, and records dir so Generate can scaffold new files
+// alongside the ones it loaded.
+func (m *Migrator) LoadDir(dir string) error {
+	if err := m.LoadFS(os.DirFS(dir), "."); err != nil {
+		return err
+	}
+	m.dir = dir
+	return nil
+}
+
+// LoadFS discovers migration files within dir in fsys, matching the
+// pattern NNN_name.up.sql / NNN_name.down.sql, and adds them to the
+// Migrator in version order. fsys may be an embed.FS, so migrations can
+// be compiled directly into the binary.
+func (m *Migrator) LoadFS(fsys fs.FS, dir string) error {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return err
+	}
+
+	type halves struct {
+		name string
+		up   string
+		down string
+	}
+	byVersion := map[int64]*halves{}
+
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+
+		match := migrationFileRe.FindStringSubmatch(e.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid migration version in %s: %w", e.Name(), err)
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+
+		h, ok := byVersion[version]
+		if !ok {
+			h = &halves{name: match[2]}
+			byVersion[version] = h
+		}
+
+		switch match[3] {
+		case "up":
+			h.up = string(b)
+		case "down":
+			h.down = string(b)
+		}
+	}
+
+	versions := make([]int64, 0, len(byVersion))
+	for v := range byVersion {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	for _, v := range versions {
+		h := byVersion[v]
+		m.Add(Migration{
+			Version: v,
+			Name:    h.name,
+			Up:      h.up,
+			Down:    h.down,
+		})
+	}
+
+	return nil
+}
+
+// Generate scaffolds a new pair of migration files (NNN_name.up.sql and
+// NNN_name.down.sql) in the directory last passed to LoadDir, using the
+// current unix timestamp as the version so filenames sort chronologically
+// and rarely collide across branches. It returns the paths of the two
+// files it created.
+func (m *Migrator) Generate(name string) (up, down string, err error) {
+	if m.dir == "" {
+		return "", "", fmt.Errorf("pgmigrate: Generate requires LoadDir to have been called first")
+	}
+
+	version := time.Now().Unix()
+	slug := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+
+	up = path.Join(m.dir, fmt.Sprintf("%d_%s.up.sql", version, slug))
+	down = path.Join(m.dir, fmt.Sprintf("%d_%s.down.sql", version, slug))
+
+	for _, p := range []string{up, down} {
+		if err := os.WriteFile(p, []byte(fmt.Sprintf("-- %s\n", name)), 0644); err != nil {
+			return "", "", err
+		}
+	}
+
+	return up, down, nil
+}
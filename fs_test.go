@@ -0,0 +1,36 @@
+package pgmigrate
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestMigratorLoadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/1_widgets_init.up.sql":   {Data: []byte("create table widgets (widget_id integer primary key);")},
+		"migrations/1_widgets_init.down.sql": {Data: []byte("drop table widgets;")},
+		"migrations/2_users_init.up.sql":     {Data: []byte("create table users (user_id integer primary key);")},
+		"migrations/2_users_init.down.sql":   {Data: []byte("drop table users;")},
+		"migrations/README.md":               {Data: []byte("not a migration")},
+	}
+
+	m := NewMigrator("")
+	if err := m.LoadFS(fsys, "migrations"); err != nil {
+		t.Fatalf("unexpected error running LoadFS: %s", err)
+	}
+
+	if len(m.gs) != 2 {
+		t.Fatalf("expected 2 migrations to be loaded, got %d", len(m.gs))
+	}
+
+	if m.gs[0].Version != 1 || m.gs[0].Name != "widgets_init" {
+		t.Fatalf("unexpected first migration: %+v", m.gs[0])
+	}
+	if m.gs[0].Up != "create table widgets (widget_id integer primary key);" {
+		t.Fatalf("unexpected Up for first migration: %q", m.gs[0].Up)
+	}
+
+	if m.gs[1].Version != 2 || m.gs[1].Name != "users_init" {
+		t.Fatalf("unexpected second migration: %+v", m.gs[1])
+	}
+}
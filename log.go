@@ -0,0 +1,90 @@
+package pgmigrate
+
+import (
+	"log"
+	"time"
+)
+
+// Direction indicates whether a migration was applied (up) or reverted
+// (down).
+type Direction string
+
+const (
+	Up   Direction = "up"
+	Down Direction = "down"
+)
+
+// MigrationResult records the outcome of applying or reverting a single
+// Migration, so callers can render a report or export timing metrics.
+type MigrationResult struct {
+	Version   int64
+	Name      string
+	Direction Direction
+	Duration  time.Duration
+	Err       error
+}
+
+// Logger receives events as a Migrator performs its work. Implementations
+// can wire these into slog, zap, OpenTelemetry spans, Prometheus
+// histograms, or anything else, without patching pgmigrate itself. Set
+// Migrator.Logger to use one.
+type Logger interface {
+	// OnMigrationStart is called immediately before a migration's Up or
+	// Down is executed.
+	OnMigrationStart(g *Migration, direction Direction)
+
+	// OnMigrationComplete is called after a migration finishes, whether it
+	// succeeded or failed. err is nil on success.
+	OnMigrationComplete(version int64, name string, direction Direction, duration time.Duration, err error)
+
+	// OnLockAcquired is called once the session's advisory lock has been
+	// obtained.
+	OnLockAcquired()
+
+	// OnProgress is called for informational messages that aren't tied to
+	// a specific migration's Up or Down, such as connecting, obtaining
+	// the advisory lock, creating schema_migrations, or running a
+	// zero-downtime Start, Complete, or Rollback block.
+	OnProgress(message string)
+
+	// OnError is called for errors that aren't reported through
+	// OnMigrationComplete, such as a failure releasing the advisory lock
+	// or running a zero-downtime Start, Complete, or Rollback block.
+	OnError(err error)
+}
+
+// defaultLogger reproduces pgmigrate's historical log.Println output, and
+// is used when a Migrator has no Logger set.
+type defaultLogger struct{}
+
+func (defaultLogger) OnMigrationStart(g *Migration, direction Direction) {
+	if direction == Down {
+		log.Printf("migrate %s: reverting %s...\n", direction, g)
+		return
+	}
+	log.Printf("migrate %s: applying %s...\n", direction, g)
+}
+
+func (defaultLogger) OnMigrationComplete(version int64, name string, direction Direction, duration time.Duration, err error) {
+	verb, done := "applying", "applied"
+	if direction == Down {
+		verb, done = "reverting", "reverted"
+	}
+	if err != nil {
+		log.Printf("migrate %s: fatal error %s \"%d: %s\": %s\n", direction, verb, version, name, err)
+		return
+	}
+	log.Printf("migrate %s: successfully %s \"%d: %s\" in %v.\n", direction, done, version, name, duration)
+}
+
+func (defaultLogger) OnLockAcquired() {
+	log.Println("migrate: obtained lock!")
+}
+
+func (defaultLogger) OnProgress(message string) {
+	log.Println(message)
+}
+
+func (defaultLogger) OnError(err error) {
+	log.Println("migrate:", err)
+}
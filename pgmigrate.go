@@ -2,20 +2,48 @@
 package pgmigrate
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"database/sql"
 	"fmt"
 	"hash/crc32"
-	"log"
 	"sort"
+	"strings"
 	"time"
-
-	_ "github.com/lib/pq"
 )
 
 // Migrator contains a database connection and required state to perform migrations.
 type Migrator struct {
-	url string
-	gs  []*Migration
+	url         string
+	sqlDB       *sql.DB
+	connectFunc ConnFunc
+	gs          []*Migration
+
+	// dir is the directory last passed to LoadDir, used by Generate to
+	// scaffold new migration files alongside the ones already loaded.
+	dir string
+
+	// StatementTimeout, if set, is applied via `set local statement_timeout`
+	// inside every migration's transaction, so a runaway statement (e.g. an
+	// ALTER TABLE taking a lock it can't get) is aborted rather than
+	// blocking forever. A Migration's own StatementTimeout, if set, takes
+	// precedence over this default.
+	StatementTimeout time.Duration
+
+	// Logger receives lifecycle events as the Migrator does its work. If
+	// nil, events are written to the standard logger as pgmigrate has
+	// always done.
+	Logger Logger
+}
+
+// logger returns m.Logger, or a defaultLogger reproducing pgmigrate's
+// historical log.Println output if none was set.
+func (m *Migrator) logger() Logger {
+	if m.Logger != nil {
+		return m.Logger
+	}
+	return defaultLogger{}
 }
 
 // Migration is an individual database migration to be performed.
@@ -25,6 +53,58 @@ type Migration struct {
 	Up      string
 	Down    string
 	applied bool
+
+	// Start, Complete, and Rollback are optional SQL blocks that turn this
+	// Migration into a zero-downtime, expand/contract migration. Start is
+	// executed by Migrator.Start to create a new versioned schema (views
+	// over the underlying tables) so that old and new application
+	// instances can run side by side. Complete is executed by
+	// Migrator.Complete once every instance has moved to the new shape,
+	// and Rollback is executed by Migrator.Rollback to abandon the
+	// migration while it is still active.
+	Start    string
+	Complete string
+	Rollback string
+
+	// StatementTimeout, if set, overrides the Migrator's StatementTimeout
+	// for this Migration only.
+	StatementTimeout time.Duration
+
+	// Transactional controls whether this Migration's Up and Down run
+	// inside a transaction. It defaults to true; set it to a pointer to
+	// false for migrations containing statements that cannot run inside a
+	// transaction, such as CREATE INDEX CONCURRENTLY, ALTER TYPE ... ADD
+	// VALUE, or VACUUM. When false, the migrator records the migration as
+	// dirty before running it and clears the flag only after it succeeds,
+	// so a partial failure is detectable and blocks further Up/Down until
+	// Force or Repair is called.
+	Transactional *bool
+}
+
+// transactional reports the effective value of Transactional, treating a
+// nil pointer as true.
+func (g *Migration) transactional() bool {
+	return g.Transactional == nil || *g.Transactional
+}
+
+// zeroDowntime reports whether g is an expand/contract migration, i.e. it
+// carries a Start, Complete, or Rollback block and is applied through
+// Migrator.Start, Migrator.Complete, and Migrator.Rollback rather than
+// UpOne/UpAll/DownOne/DownAll.
+func (g *Migration) zeroDowntime() bool {
+	return g.Start != "" || g.Complete != "" || g.Rollback != ""
+}
+
+// checksumMatches reports whether recorded, the checksum stored in
+// schema_migrations for g, matches the SHA-256 checksum of g's current Up
+// block. recorded is empty for rows applied before checksums were
+// tracked, which always match.
+func checksumMatches(g *Migration, recorded []byte) bool {
+	if len(recorded) == 0 {
+		return true
+	}
+	sum := sha256.Sum256([]byte(g.Up))
+	return bytes.Equal(sum[:], recorded)
 }
 
 // String returns a string that describes the Migration
@@ -32,13 +112,43 @@ func (g *Migration) String() string {
 	return fmt.Sprintf(`"%d: %s"`, g.Version, g.Name)
 }
 
-// NewMigrator creates a new Migrator for the given postgres url.
+// NewMigrator creates a new Migrator for the given postgres://,
+// postgresql:// or pgx:// url, opened with database/sql. postgres:// and
+// postgresql:// urls use the driver registered as "postgres" (see the
+// driver/pq subpackage to register lib/pq); pgx:// urls use pgx's own
+// database/sql driver, registered as "pgx" by importing
+// github.com/jackc/pgx/v5/stdlib. To use a native pgx pool instead, see
+// the driver/pgx subpackage's NewMigrator and NewMigratorWithPool.
 func NewMigrator(url string) *Migrator {
 	return &Migrator{
 		url: url,
 	}
 }
 
+// NewMigratorWithDB creates a new Migrator around an existing *sql.DB,
+// such as one opened against pgx's database/sql driver or lib/pq, with
+// its own pooling, TLS, and context handling already configured. The
+// Migrator does not close db; each session pins a single connection from
+// it for as long as the session lasts (see DB) and releases it back to
+// db afterwards.
+func NewMigratorWithDB(db *sql.DB) *Migrator {
+	return &Migrator{sqlDB: db}
+}
+
+// ConnFunc acquires the DB to use for a session: a single physical
+// connection pinned for as long as the session lasts (see DB). Driver
+// subpackages that want to support a native client without pgmigrate
+// depending on it (see driver/pgx) build a Migrator around one with
+// NewMigratorWithConnFunc.
+type ConnFunc func(ctx context.Context) (DB, error)
+
+// NewMigratorWithConnFunc creates a new Migrator that calls connect to
+// acquire a session's DB, instead of opening one from a url or an
+// existing *sql.DB.
+func NewMigratorWithConnFunc(connect ConnFunc) *Migrator {
+	return &Migrator{connectFunc: connect}
+}
+
 // Add adds Migrations to the Migrator. This method can be called repeatedly
 // any time before an Up or Down method is called.
 func (m *Migrator) Add(gs ...Migration) *Migrator {
@@ -51,22 +161,54 @@ func (m *Migrator) Add(gs ...Migration) *Migrator {
 
 // UpOne applies the next pending migration, if any.
 func (m *Migrator) UpOne() error {
-	return m.apply(1)
+	_, err := m.UpOneContext(context.Background())
+	return err
+}
+
+// UpOneContext applies the next pending migration, if any, aborting if ctx
+// is cancelled. It returns a MigrationResult for the migration it
+// attempted, if any.
+func (m *Migrator) UpOneContext(ctx context.Context) ([]MigrationResult, error) {
+	return m.apply(ctx, 1)
 }
 
 // UpAll applies all pending migrations, if any.
 func (m *Migrator) UpAll() error {
-	return m.apply(0)
+	_, err := m.UpAllContext(context.Background())
+	return err
+}
+
+// UpAllContext applies all pending migrations, if any, aborting if ctx is
+// cancelled. It returns a MigrationResult for every migration it
+// attempted.
+func (m *Migrator) UpAllContext(ctx context.Context) ([]MigrationResult, error) {
+	return m.apply(ctx, 0)
 }
 
 // DownOne reverts the most recently applied migration, if any.
 func (m *Migrator) DownOne() error {
-	return m.revert(1)
+	_, err := m.DownOneContext(context.Background())
+	return err
+}
+
+// DownOneContext reverts the most recently applied migration, if any,
+// aborting if ctx is cancelled. It returns a MigrationResult for the
+// migration it attempted, if any.
+func (m *Migrator) DownOneContext(ctx context.Context) ([]MigrationResult, error) {
+	return m.revert(ctx, 1)
 }
 
 // DownAll applies all applied migrations, if any.
 func (m *Migrator) DownAll() error {
-	return m.revert(0)
+	_, err := m.DownAllContext(context.Background())
+	return err
+}
+
+// DownAllContext reverts all applied migrations, if any, aborting if ctx
+// is cancelled. It returns a MigrationResult for every migration it
+// attempted.
+func (m *Migrator) DownAllContext(ctx context.Context) ([]MigrationResult, error) {
+	return m.revert(ctx, 0)
 }
 
 func (m *Migrator) find(fn func(*Migration) bool) []*Migration {
@@ -79,175 +221,763 @@ func (m *Migrator) find(fn func(*Migration) bool) []*Migration {
 	return gs
 }
 
-func (m *Migrator) withSession(fn func(db *sql.DB) error) error {
-	// establish connection, later close it
-	log.Println("migrate: connecting...")
-	db, err := sql.Open("postgres", m.url)
+// connect acquires the DB to use for a session: a single physical
+// connection pinned for as long as the session lasts (see DB). If the
+// Migrator was built with NewMigratorWithDB, that connection is acquired
+// from the *sql.DB given to it and released back to it when the session
+// ends. If it was built with NewMigratorWithConnFunc (see driver/pgx),
+// connectFunc is called instead. Otherwise a *sql.DB is opened from url
+// with driver "postgres" (or, for a pgx:// url, with driver "pgx" and the
+// scheme rewritten to postgres://), a connection is acquired from it, and
+// both the connection and the *sql.DB are closed when the session ends.
+func (m *Migrator) connect(ctx context.Context) (DB, error) {
+	if m.connectFunc != nil {
+		return m.connectFunc(ctx)
+	}
+
+	if m.sqlDB != nil {
+		conn, err := m.sqlDB.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return &sqlConn{conn}, nil
+	}
+
+	m.logger().OnProgress("migrate: connecting...")
+	driver, dsn := "postgres", m.url
+	if strings.HasPrefix(m.url, "pgx://") {
+		driver, dsn = "pgx", "postgres://"+strings.TrimPrefix(m.url, "pgx://")
+	}
+	sdb, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sdb.Conn(ctx)
+	if err != nil {
+		sdb.Close()
+		return nil, err
+	}
+	return &ownedSQLDB{sqlConn{conn}, sdb}, nil
+}
+
+// ensureSchemaMigrationsTable creates the schema_migrations table if it
+// does not exist, or adds the name/checksum/applied_at/dirty columns to
+// an older one created before they existed.
+func (m *Migrator) ensureSchemaMigrationsTable(ctx context.Context, db DB) error {
+	var exists bool
+	if err := db.QueryRow(ctx, `select exists (select 1 from information_schema.tables where table_name = 'schema_migrations');`).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		m.logger().OnProgress("migrate: schema_migrations table does not exist, creating...")
+		return db.Exec(ctx, `
+			create table schema_migrations (
+				version bigint primary key,
+				name text,
+				checksum bytea,
+				applied_at timestamptz not null default now(),
+				dirty bool not null default false
+			);
+		`)
+	}
+
+	for _, stmt := range []string{
+		`alter table schema_migrations add column if not exists name text;`,
+		`alter table schema_migrations add column if not exists checksum bytea;`,
+		`alter table schema_migrations add column if not exists applied_at timestamptz not null default now();`,
+		`alter table schema_migrations add column if not exists dirty bool not null default false;`,
+	} {
+		if err := db.Exec(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withRawSession establishes a connection, obtains the advisory lock, and
+// ensures schema_migrations exists, but does not load migration state or
+// check for a dirty version. It is used by Force and Repair, which must
+// be able to run against a database a normal session would refuse to
+// touch.
+func (m *Migrator) withRawSession(ctx context.Context, fn func(db DB) error) error {
+	// acquire the session's single pinned connection, later release it
+	db, err := m.connect(ctx)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		log.Println("migrate: closing connection...")
+		m.logger().OnProgress("migrate: releasing connection...")
 		if err := db.Close(); err != nil {
-			log.Println("migrate: unable to close connection:", err)
+			m.logger().OnError(fmt.Errorf("unable to release connection: %w", err))
 		}
 	}()
 
-	// obtain advisory lock, later release it
+	// obtain advisory lock, later release it; the release always runs
+	// against a fresh context so a cancellation that aborted the migration
+	// itself doesn't also prevent cleanup.
 	lockId := crc32.ChecksumIEEE([]byte(m.url))
-	log.Println("migrate: obtaining lock...")
-	if _, err := db.Exec(`select pg_advisory_lock($1)`, lockId); err != nil {
+	m.logger().OnProgress("migrate: obtaining lock...")
+	if err := db.Exec(ctx, `select pg_advisory_lock($1)`, lockId); err != nil {
 		return err
 	}
-	log.Println("migrate: obtained lock!")
+	m.logger().OnLockAcquired()
 	defer func() {
-		log.Println("migrate: releasing lock...")
-		if _, err := db.Exec(`select pg_advisory_unlock($1)`, lockId); err != nil {
-			log.Println("migrate: unable to release lock:", err)
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		m.logger().OnProgress("migrate: releasing lock...")
+		if err := db.Exec(cleanupCtx, `select pg_advisory_unlock($1)`, lockId); err != nil {
+			m.logger().OnError(fmt.Errorf("unable to release lock: %w", err))
 		}
 	}()
 
-	// ensure schema_migrations table exists
-	var exists bool
-	if err := db.QueryRow(`select exists (select 1 from information_schema.tables where table_name = 'schema_migrations');`).Scan(&exists); err != nil {
+	if err := m.ensureSchemaMigrationsTable(ctx, db); err != nil {
 		return err
 	}
-	if !exists {
-		log.Println("migrate: schema_migrations table does not exist, creating...")
-		if _, err := db.Exec(`create table schema_migrations (version bigint primary key);`); err != nil {
-			return err
-		}
-	}
 
-	// reset migration state
-	for _, g := range m.gs {
-		g.applied = false
-	}
+	return fn(db)
+}
 
-	// update state for applied migrations
-	rows, err := db.Query(`select version from schema_migrations order by version asc`)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var v int64
-		if err := rows.Scan(&v); err != nil {
+func (m *Migrator) withSession(ctx context.Context, fn func(db DB) error) error {
+	return m.withRawSession(ctx, func(db DB) error {
+		// reset migration state
+		for _, g := range m.gs {
+			g.applied = false
+		}
+
+		// update state for applied migrations, refusing to continue if a
+		// previous migration was left dirty by a failed run, or if an
+		// applied migration's Up no longer matches what was recorded
+		rows, err := db.Query(ctx, `select version, checksum, dirty from schema_migrations order by version asc`)
+		if err != nil {
 			return err
 		}
-		found := false
-		for _, g := range m.gs {
-			if v == g.Version {
-				g.applied = true
-				found = true
-				break
+		defer rows.Close()
+		for rows.Next() {
+			var v int64
+			var checksum []byte
+			var dirty bool
+			if err := rows.Scan(&v, &checksum, &dirty); err != nil {
+				return err
+			}
+			if dirty {
+				return fmt.Errorf("migration version %d is marked dirty (a previous migration failed partway through); run Force or Repair before continuing", v)
+			}
+			found := false
+			for _, g := range m.gs {
+				if v == g.Version {
+					g.applied = true
+					found = true
+					if !checksumMatches(g, checksum) {
+						return fmt.Errorf("migration %s has been modified since it was applied (checksum mismatch)", g)
+					}
+					break
+				}
+			}
+			if !found {
+				return fmt.Errorf("unable to find migration for schema_migrations version %d! gs: %+v", v, m.gs)
 			}
 		}
-		if !found {
-			return fmt.Errorf("unable to find migration for schema_migrations version %d! gs: %+v", v, m.gs)
+		if err := rows.Err(); err != nil {
+			return err
 		}
-	}
-	if err := rows.Err(); err != nil {
-		return err
-	}
 
-	// sort migrations by version
-	sort.Slice(m.gs, func(i, j int) bool { return m.gs[i].Version < m.gs[j].Version })
+		// sort migrations by version
+		sort.Slice(m.gs, func(i, j int) bool { return m.gs[i].Version < m.gs[j].Version })
 
-	// execute given function
-	return fn(db)
+		// execute given function
+		return fn(db)
+	})
+}
+
+// statementTimeout returns the statement timeout to apply for g: its own
+// StatementTimeout if set, otherwise the Migrator's default.
+func (m *Migrator) statementTimeout(g *Migration) time.Duration {
+	if g.StatementTimeout > 0 {
+		return g.StatementTimeout
+	}
+	return m.StatementTimeout
+}
+
+// setStatementTimeout issues `set local statement_timeout` inside tx if a
+// timeout applies to g, so the statements that follow are aborted rather
+// than blocking forever.
+func (m *Migrator) setStatementTimeout(ctx context.Context, tx Tx, g *Migration) error {
+	timeout := m.statementTimeout(g)
+	if timeout <= 0 {
+		return nil
+	}
+	return tx.Exec(ctx, fmt.Sprintf(`set local statement_timeout = %d`, timeout.Milliseconds()))
 }
 
-func (m *Migrator) apply(n int) error {
-	return m.withSession(func(db *sql.DB) error {
-		// Get pending up migrations
-		gs := m.find(func(g *Migration) bool { return g.applied == false })
+func (m *Migrator) apply(ctx context.Context, n int) ([]MigrationResult, error) {
+	var results []MigrationResult
+
+	err := m.withSession(ctx, func(db DB) error {
+		// Get pending up migrations, excluding zero-downtime migrations,
+		// which are only ever applied through Start and Complete
+		gs := m.find(func(g *Migration) bool { return g.applied == false && !g.zeroDowntime() })
 		sort.Slice(gs, func(i, j int) bool { return gs[i].Version < gs[j].Version })
 
 		// Apply up to N migrations
-		log.Printf("migrate up: there are %d pending migrations.\n", len(gs))
+		m.logger().OnProgress(fmt.Sprintf("migrate up: there are %d pending migrations.", len(gs)))
 		for i, g := range gs {
 			if n > 0 && i >= n {
 				break
 			}
 
 			t := time.Now()
-			log.Printf("migrate up: applying %s...\n", g)
-
-			tx, err := db.Begin()
+			m.logger().OnMigrationStart(g, Up)
+
+			err := func() error {
+				sum := sha256.Sum256([]byte(g.Up))
+
+				if !g.transactional() {
+					// record the migration as dirty before running it, so a
+					// crash partway through is detectable
+					if err := db.Exec(ctx, `insert into schema_migrations (version, name, checksum, dirty) values ($1, $2, $3, true)`, g.Version, g.Name, sum[:]); err != nil {
+						return err
+					}
+
+					if err := db.Exec(ctx, g.Up); err != nil {
+						return fmt.Errorf("%w (source: %s)", err, g.Up)
+					}
+
+					return db.Exec(ctx, `update schema_migrations set dirty = false where version = $1`, g.Version)
+				}
+
+				tx, err := db.Begin(ctx)
+				if err != nil {
+					return err
+				}
+
+				if err := m.setStatementTimeout(ctx, tx, g); err != nil {
+					tx.Rollback(ctx)
+					return err
+				}
+
+				if err := tx.Exec(ctx, g.Up); err != nil {
+					tx.Rollback(ctx)
+					return fmt.Errorf("%w (source: %s)", err, g.Up)
+				}
+
+				if err := tx.Exec(ctx, `insert into schema_migrations (version, name, checksum) values ($1, $2, $3)`, g.Version, g.Name, sum[:]); err != nil {
+					tx.Rollback(ctx)
+					return err
+				}
+
+				if err := tx.Commit(ctx); err != nil {
+					tx.Rollback(ctx)
+					return err
+				}
+
+				return nil
+			}()
+
+			duration := time.Since(t)
+			m.logger().OnMigrationComplete(g.Version, g.Name, Up, duration, err)
+			results = append(results, MigrationResult{Version: g.Version, Name: g.Name, Direction: Up, Duration: duration, Err: err})
 			if err != nil {
 				return err
 			}
-
-			if _, err := tx.Exec(g.Up); err != nil {
-				log.Printf("migrate up: fatal error error applying %s: %s\n", g, err)
-				log.Println("source:", g.Up)
-				tx.Rollback()
-				return err
-			}
-
-			if _, err := tx.Exec(`insert into schema_migrations (version) values ($1)`, g.Version); err != nil {
-				log.Printf("migrate up: fatal error error applying %s: %s\n", g, err)
-				tx.Rollback()
-				return err
-			}
-
-			if err := tx.Commit(); err != nil {
-				log.Printf("migrate up: fatal error error applying %s: %s\n", g, err)
-				tx.Rollback()
-				return err
-			}
-
-			log.Printf("migrate up: successfully applied %s in %v.\n", g, time.Since(t))
 		}
 
 		return nil
 	})
+
+	return results, err
 }
 
-func (m *Migrator) revert(n int) error {
-	return m.withSession(func(db *sql.DB) error {
-		// Get pending down migrations
-		gs := m.find(func(g *Migration) bool { return g.applied == true })
+func (m *Migrator) revert(ctx context.Context, n int) ([]MigrationResult, error) {
+	var results []MigrationResult
+
+	err := m.withSession(ctx, func(db DB) error {
+		// Get pending down migrations, excluding zero-downtime migrations,
+		// which are only ever reverted through Rollback
+		gs := m.find(func(g *Migration) bool { return g.applied == true && !g.zeroDowntime() })
 		sort.Slice(gs, func(i, j int) bool { return gs[i].Version > gs[j].Version })
 
 		// Revert up to N migrations
-		log.Printf("migrate down: there are %d applied migrations.\n", len(gs))
+		m.logger().OnProgress(fmt.Sprintf("migrate down: there are %d applied migrations.", len(gs)))
 		for i, g := range gs {
 			if n > 0 && i >= n {
 				break
 			}
 
 			t := time.Now()
-			log.Printf("migrate down: reverting %s...\n", g)
-
-			tx, err := db.Begin()
+			m.logger().OnMigrationStart(g, Down)
+
+			err := func() error {
+				if !g.transactional() {
+					// record the migration as dirty before reverting it, so
+					// a crash partway through is detectable
+					if err := db.Exec(ctx, `update schema_migrations set dirty = true where version = $1`, g.Version); err != nil {
+						return err
+					}
+
+					if err := db.Exec(ctx, g.Down); err != nil {
+						return fmt.Errorf("%w (source: %s)", err, g.Down)
+					}
+
+					return db.Exec(ctx, `delete from schema_migrations where version = $1`, g.Version)
+				}
+
+				tx, err := db.Begin(ctx)
+				if err != nil {
+					return err
+				}
+
+				if err := m.setStatementTimeout(ctx, tx, g); err != nil {
+					tx.Rollback(ctx)
+					return err
+				}
+
+				if err := tx.Exec(ctx, g.Down); err != nil {
+					tx.Rollback(ctx)
+					return fmt.Errorf("%w (source: %s)", err, g.Down)
+				}
+
+				if err := tx.Exec(ctx, `delete from schema_migrations where version = $1`, g.Version); err != nil {
+					tx.Rollback(ctx)
+					return err
+				}
+
+				if err := tx.Commit(ctx); err != nil {
+					tx.Rollback(ctx)
+					return err
+				}
+
+				return nil
+			}()
+
+			duration := time.Since(t)
+			m.logger().OnMigrationComplete(g.Version, g.Name, Down, duration, err)
+			results = append(results, MigrationResult{Version: g.Version, Name: g.Name, Direction: Down, Duration: duration, Err: err})
 			if err != nil {
 				return err
 			}
+		}
 
-			if _, err := tx.Exec(g.Down); err != nil {
-				log.Printf("migrate down: fatal error error reverting %s: %s\n", g, err)
-				log.Println("source:", g.Down)
-				tx.Rollback()
-				return err
-			}
+		return nil
+	})
 
-			if _, err := tx.Exec(`delete from schema_migrations where version = $1`, g.Version); err != nil {
-				log.Printf("migrate down: fatal error error reverting %s: %s\n", g, err)
-				tx.Rollback()
+	return results, err
+}
+
+// pgmigrateSchema is the Postgres schema used to track the state of
+// zero-downtime migrations, separate from the public schema_migrations
+// table.
+const pgmigrateSchema = "pgmigrate"
+
+// migrationState describes a zero-downtime migration's position in the
+// linear migration history and whether it is still active, i.e. old and
+// new versioned schemas both exist and are in use.
+type migrationState struct {
+	Version       int64
+	ParentVersion int64
+	Active        bool
+}
+
+// versionedSchemaName returns the name of the Postgres schema that holds
+// the versioned views for the given migration version.
+func versionedSchemaName(version int64) string {
+	return fmt.Sprintf("%s_v%d", pgmigrateSchema, version)
+}
+
+// findOne returns the registered Migration with the given version, or nil
+// if no such Migration has been added.
+func (m *Migrator) findOne(version int64) *Migration {
+	for _, g := range m.gs {
+		if g.Version == version {
+			return g
+		}
+	}
+	return nil
+}
+
+// ensurePgmigrateSchema creates the pgmigrate schema and its
+// migration_state table if they do not already exist. A partial unique
+// index on the active column ensures only one migration can be active at
+// a time.
+func (m *Migrator) ensurePgmigrateSchema(ctx context.Context, db DB) error {
+	if err := db.Exec(ctx, fmt.Sprintf(`create schema if not exists %s`, pgmigrateSchema)); err != nil {
+		return err
+	}
+	if err := db.Exec(ctx, fmt.Sprintf(`
+		create table if not exists %s.migration_state (
+			version bigint primary key,
+			parent_version bigint not null,
+			active bool not null default true
+		)
+	`, pgmigrateSchema)); err != nil {
+		return err
+	}
+	if err := db.Exec(ctx, fmt.Sprintf(`
+		create unique index if not exists migration_state_active_idx on %s.migration_state (active) where active
+	`, pgmigrateSchema)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// activeMigration returns the currently active zero-downtime migration's
+// state, or nil if none is active.
+func (m *Migrator) activeMigration(ctx context.Context, db DB) (*migrationState, error) {
+	var s migrationState
+	row := db.QueryRow(ctx, fmt.Sprintf(`select version, parent_version, active from %s.migration_state where active limit 1`, pgmigrateSchema))
+	if err := row.Scan(&s.Version, &s.ParentVersion, &s.Active); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// latestVersion returns the highest version currently recorded as applied
+// in schema_migrations, or 0 if none have been applied.
+func (m *Migrator) latestVersion(ctx context.Context, db DB) (int64, error) {
+	var v sql.NullInt64
+	if err := db.QueryRow(ctx, `select max(version) from schema_migrations`).Scan(&v); err != nil {
+		return 0, err
+	}
+	return v.Int64, nil
+}
+
+// viewSource is the subset of DB and Tx that createVersionedViews needs:
+// enough to list the public schema's tables and create views over them,
+// whether it's called against a plain session or against the
+// transaction that just ran a migration's Start block, so the views it
+// creates reflect that transaction's not-yet-committed DDL.
+type viewSource interface {
+	Query(ctx context.Context, query string, args ...interface{}) (Rows, error)
+	Exec(ctx context.Context, query string, args ...interface{}) error
+}
+
+// createVersionedViews creates a view in the given schema for every table
+// in the public schema, so that application instances connected with
+// search_path set to the versioned schema see the previous (or next)
+// shape of the database.
+func (m *Migrator) createVersionedViews(ctx context.Context, db viewSource, schema string) error {
+	rows, err := db.Query(ctx, `select table_name from information_schema.tables where table_schema = 'public' and table_name <> 'schema_migrations'`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return err
+		}
+		tables = append(tables, t)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		m.logger().OnProgress(fmt.Sprintf("migrate start: creating view %s.%s...", schema, t))
+		if err := db.Exec(ctx, fmt.Sprintf(`create view %s.%s as select * from public.%s`, schema, t, t)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Start begins a zero-downtime migration to the given version. It runs
+// the migration's Start block (the expand DDL), then creates a new
+// schema (pgmigrate_v<version>) containing views over the tables in
+// their post-DDL shape, and records the migration as active so new
+// application instances can point search_path at that schema while old
+// instances keep running against the schema created the same way when
+// the parent version was started. If the parent version was not itself
+// started this way (it was applied by UpOne or UpAll, or no migration has
+// been applied yet), no versioned schema exists for it, and Start does not
+// create one.
+func (m *Migrator) Start(version int64) error {
+	ctx := context.Background()
+	return m.withSession(ctx, func(db DB) error {
+		g := m.findOne(version)
+		if g == nil {
+			return fmt.Errorf("no migration registered for version %d", version)
+		}
+		if g.Start == "" {
+			return fmt.Errorf("migration %s has no Start block", g)
+		}
+
+		if err := m.ensurePgmigrateSchema(ctx, db); err != nil {
+			return err
+		}
+
+		active, err := m.activeMigration(ctx, db)
+		if err != nil {
+			return err
+		}
+		if active != nil {
+			return fmt.Errorf("migration version %d is already active, run Complete or Rollback first", active.Version)
+		}
+
+		parent, err := m.latestVersion(ctx, db)
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := m.setStatementTimeout(ctx, tx, g); err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+
+		m.logger().OnProgress(fmt.Sprintf("migrate start: starting %s...", g))
+		if err := tx.Exec(ctx, g.Start); err != nil {
+			m.logger().OnError(fmt.Errorf("migrate start: fatal error starting %s: %w", g, err))
+			tx.Rollback(ctx)
+			return err
+		}
+
+		// create the versioned schema and populate its views only now
+		// that g.Start has run, so they reflect the post-DDL shape rather
+		// than a stale snapshot of what public looked like beforehand
+		schema := versionedSchemaName(version)
+		m.logger().OnProgress(fmt.Sprintf("migrate start: creating schema %s...", schema))
+		if err := tx.Exec(ctx, fmt.Sprintf(`create schema %s`, schema)); err != nil {
+			m.logger().OnError(fmt.Errorf("migrate start: fatal error starting %s: %w", g, err))
+			tx.Rollback(ctx)
+			return err
+		}
+		if err := m.createVersionedViews(ctx, tx, schema); err != nil {
+			m.logger().OnError(fmt.Errorf("migrate start: fatal error starting %s: %w", g, err))
+			tx.Rollback(ctx)
+			return err
+		}
+
+		if err := tx.Exec(ctx,
+			fmt.Sprintf(`insert into %s.migration_state (version, parent_version, active) values ($1, $2, true)`, pgmigrateSchema),
+			g.Version, parent,
+		); err != nil {
+			m.logger().OnError(fmt.Errorf("migrate start: fatal error starting %s: %w", g, err))
+			tx.Rollback(ctx)
+			return err
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+
+		m.logger().OnProgress(fmt.Sprintf("migrate start: %s is now active; new instances should use schema %s, old instances should use schema %s.", g, schema, versionedSchemaName(parent)))
+		return nil
+	})
+}
+
+// Complete finishes the active zero-downtime migration: it runs the
+// migration's Complete block, records the migration as applied in
+// schema_migrations, and drops the previous versioned schema now that
+// every application instance has moved to the new shape.
+func (m *Migrator) Complete() error {
+	ctx := context.Background()
+	return m.withSession(ctx, func(db DB) error {
+		if err := m.ensurePgmigrateSchema(ctx, db); err != nil {
+			return err
+		}
+
+		active, err := m.activeMigration(ctx, db)
+		if err != nil {
+			return err
+		}
+		if active == nil {
+			return fmt.Errorf("no migration is currently active")
+		}
+
+		g := m.findOne(active.Version)
+		if g == nil {
+			return fmt.Errorf("no migration registered for version %d", active.Version)
+		}
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return err
+		}
+
+		if err := m.setStatementTimeout(ctx, tx, g); err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+
+		if g.Complete != "" {
+			m.logger().OnProgress(fmt.Sprintf("migrate complete: completing %s...", g))
+			if err := tx.Exec(ctx, g.Complete); err != nil {
+				m.logger().OnError(fmt.Errorf("migrate complete: fatal error completing %s: %w", g, err))
+				tx.Rollback(ctx)
 				return err
 			}
+		}
+
+		sum := sha256.Sum256([]byte(g.Up))
+		if err := tx.Exec(ctx, `insert into schema_migrations (version, name, checksum) values ($1, $2, $3)`, g.Version, g.Name, sum[:]); err != nil {
+			m.logger().OnError(fmt.Errorf("migrate complete: fatal error completing %s: %w", g, err))
+			tx.Rollback(ctx)
+			return err
+		}
+
+		if err := tx.Exec(ctx, fmt.Sprintf(`update %s.migration_state set active = false where version = $1`, pgmigrateSchema), g.Version); err != nil {
+			m.logger().OnError(fmt.Errorf("migrate complete: fatal error completing %s: %w", g, err))
+			tx.Rollback(ctx)
+			return err
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+
+		parentSchema := versionedSchemaName(active.ParentVersion)
+		m.logger().OnProgress(fmt.Sprintf("migrate complete: dropping schema %s...", parentSchema))
+		if err := db.Exec(ctx, fmt.Sprintf(`drop schema if exists %s cascade`, parentSchema)); err != nil {
+			return err
+		}
+
+		g.applied = true
+		m.logger().OnProgress(fmt.Sprintf("migrate complete: %s is now complete.", g))
+		return nil
+	})
+}
+
+// Rollback abandons the active zero-downtime migration: it drops the new
+// versioned schema and then runs the migration's Rollback block, leaving
+// old application instances unaffected.
+func (m *Migrator) Rollback() error {
+	ctx := context.Background()
+	return m.withSession(ctx, func(db DB) error {
+		if err := m.ensurePgmigrateSchema(ctx, db); err != nil {
+			return err
+		}
+
+		active, err := m.activeMigration(ctx, db)
+		if err != nil {
+			return err
+		}
+		if active == nil {
+			return fmt.Errorf("no migration is currently active")
+		}
+
+		g := m.findOne(active.Version)
+		if g == nil {
+			return fmt.Errorf("no migration registered for version %d", active.Version)
+		}
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			return err
+		}
 
-			if err := tx.Commit(); err != nil {
-				log.Printf("migrate down: fatal error error reverting %s: %s\n", g, err)
-				tx.Rollback()
+		if err := m.setStatementTimeout(ctx, tx, g); err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+
+		// drop the new versioned schema first, since its views depend on
+		// the columns the Rollback block may drop
+		schema := versionedSchemaName(g.Version)
+		m.logger().OnProgress(fmt.Sprintf("migrate rollback: dropping schema %s...", schema))
+		if err := tx.Exec(ctx, fmt.Sprintf(`drop schema if exists %s cascade`, schema)); err != nil {
+			m.logger().OnError(fmt.Errorf("migrate rollback: fatal error rolling back %s: %w", g, err))
+			tx.Rollback(ctx)
+			return err
+		}
+
+		if g.Rollback != "" {
+			m.logger().OnProgress(fmt.Sprintf("migrate rollback: rolling back %s...", g))
+			if err := tx.Exec(ctx, g.Rollback); err != nil {
+				m.logger().OnError(fmt.Errorf("migrate rollback: fatal error rolling back %s: %w", g, err))
+				tx.Rollback(ctx)
 				return err
 			}
+		}
 
-			log.Printf("migrate down: successfully reverted %s in %v.\n", g, time.Since(t))
+		if err := tx.Exec(ctx, fmt.Sprintf(`delete from %s.migration_state where version = $1`, pgmigrateSchema), g.Version); err != nil {
+			m.logger().OnError(fmt.Errorf("migrate rollback: fatal error rolling back %s: %w", g, err))
+			tx.Rollback(ctx)
+			return err
 		}
 
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+
+		m.logger().OnProgress(fmt.Sprintf("migrate rollback: %s has been rolled back.", g))
 		return nil
 	})
 }
+
+// IsActiveMigrationPeriod reports whether a zero-downtime migration is
+// currently in progress, i.e. Start has been called but Complete or
+// Rollback has not.
+func (m *Migrator) IsActiveMigrationPeriod() (bool, error) {
+	ctx := context.Background()
+	var active bool
+	err := m.withSession(ctx, func(db DB) error {
+		if err := m.ensurePgmigrateSchema(ctx, db); err != nil {
+			return err
+		}
+		s, err := m.activeMigration(ctx, db)
+		if err != nil {
+			return err
+		}
+		active = s != nil
+		return nil
+	})
+	return active, err
+}
+
+// LatestVersion returns the highest migration version currently recorded
+// as applied in schema_migrations, or 0 if none have been applied.
+func (m *Migrator) LatestVersion() (int64, error) {
+	ctx := context.Background()
+	var version int64
+	err := m.withSession(ctx, func(db DB) error {
+		v, err := m.latestVersion(ctx, db)
+		if err != nil {
+			return err
+		}
+		version = v
+		return nil
+	})
+	return version, err
+}
+
+// Force marks version as the current, clean state of the database,
+// without running that migration's Up or Down. Use it after manually
+// fixing up a database left dirty by a failed migration, once you've
+// confirmed whether the migration's changes did or did not take effect.
+func (m *Migrator) Force(version int64) error {
+	ctx := context.Background()
+	return m.withRawSession(ctx, func(db DB) error {
+		g := m.findOne(version)
+		if g == nil {
+			return fmt.Errorf("no migration registered for version %d", version)
+		}
+
+		sum := sha256.Sum256([]byte(g.Up))
+		return db.Exec(ctx, `
+			insert into schema_migrations (version, name, checksum, dirty)
+			values ($1, $2, $3, false)
+			on conflict (version) do update set name = excluded.name, checksum = excluded.checksum, dirty = false
+		`, g.Version, g.Name, sum[:])
+	})
+}
+
+// Repair clears the dirty flag left by a failed non-transactional
+// migration, without changing which version schema_migrations records.
+// Use Force instead if the database also needs to be marked as a
+// different version.
+func (m *Migrator) Repair() error {
+	ctx := context.Background()
+	return m.withRawSession(ctx, func(db DB) error {
+		return db.Exec(ctx, `update schema_migrations set dirty = false where dirty`)
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 	"sync"
 	"testing"
+
+	_ "github.com/jcoene/pgmigrate/driver/pq"
 )
 
 func TestPgMigrate(t *testing.T) {
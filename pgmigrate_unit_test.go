@@ -0,0 +1,63 @@
+package pgmigrate
+
+import (
+	"crypto/sha256"
+	"testing"
+	"time"
+)
+
+func TestMigrationTransactional(t *testing.T) {
+	g := &Migration{}
+	if !g.transactional() {
+		t.Fatalf("expected a Migration with no Transactional set to default to true")
+	}
+
+	yes := true
+	g.Transactional = &yes
+	if !g.transactional() {
+		t.Fatalf("expected transactional() to report true when Transactional points to true")
+	}
+
+	no := false
+	g.Transactional = &no
+	if g.transactional() {
+		t.Fatalf("expected transactional() to report false when Transactional points to false")
+	}
+}
+
+func TestChecksumMatches(t *testing.T) {
+	g := &Migration{Up: "create table widgets (widget_id integer primary key);"}
+
+	if !checksumMatches(g, nil) {
+		t.Fatalf("expected a missing recorded checksum to match (applied before checksums were tracked)")
+	}
+
+	sum := sha256.Sum256([]byte(g.Up))
+	if !checksumMatches(g, sum[:]) {
+		t.Fatalf("expected checksumMatches to match the checksum of g's current Up")
+	}
+
+	g.Up = "create table widgets (widget_id integer primary key, name text);"
+	if checksumMatches(g, sum[:]) {
+		t.Fatalf("expected checksumMatches to reject a checksum that no longer matches g's Up")
+	}
+}
+
+func TestMigratorStatementTimeout(t *testing.T) {
+	m := &Migrator{}
+	g := &Migration{}
+
+	if got := m.statementTimeout(g); got != 0 {
+		t.Fatalf("expected no statement timeout by default, got %v", got)
+	}
+
+	m.StatementTimeout = 5 * time.Second
+	if got := m.statementTimeout(g); got != 5*time.Second {
+		t.Fatalf("expected the Migrator's StatementTimeout to apply, got %v", got)
+	}
+
+	g.StatementTimeout = 2 * time.Second
+	if got := m.statementTimeout(g); got != 2*time.Second {
+		t.Fatalf("expected the Migration's own StatementTimeout to override the Migrator's, got %v", got)
+	}
+}
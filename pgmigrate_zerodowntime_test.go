@@ -0,0 +1,241 @@
+package pgmigrate
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+)
+
+// These tests share a database (and its schema_migrations table) with
+// TestPgMigrate in pgmigrate_test.go, which blank-imports driver/pq for
+// its side effect of registering lib/pq; reuse that registration here
+// rather than importing it again. To avoid disturbing TestPgMigrate's
+// own versions and tables, each test here uses its own version range and
+// table names, and cleans up every row and schema it touches before and
+// after running.
+
+func postgresTestUrl() string {
+	if u := os.Getenv("POSTGRES_URL"); u != "" {
+		return u
+	}
+	return "postgres://postgres:@127.0.0.1:5432/pgmigrate_test?sslmode=disable"
+}
+
+// resetZeroDowntimeState removes everything the tests in this file might
+// have left behind from a previous run: their own schema_migrations and
+// migration_state rows, their tables, and their versioned schemas. It
+// does not touch any other version, so it's safe to run even if
+// TestPgMigrate has already left its own migrations applied.
+func resetZeroDowntimeState(t *testing.T, raw *sql.DB, versions []int64, tables []string) {
+	t.Helper()
+	for _, v := range versions {
+		if _, err := raw.Exec(`delete from schema_migrations where version = $1`, v); err != nil {
+			t.Fatalf("unexpected error resetting schema_migrations: %s", err)
+		}
+		if _, err := raw.Exec(`delete from pgmigrate.migration_state where version = $1`, v); err != nil {
+			// migration_state doesn't exist until ensurePgmigrateSchema has
+			// run once; ignore "relation does not exist" on a fresh database
+		}
+		if _, err := raw.Exec(fmt.Sprintf(`drop schema if exists %s cascade`, versionedSchemaName(v))); err != nil {
+			t.Fatalf("unexpected error dropping versioned schema for version %d: %s", v, err)
+		}
+	}
+	for _, table := range tables {
+		if _, err := raw.Exec(fmt.Sprintf(`drop table if exists %s cascade`, table)); err != nil {
+			t.Fatalf("unexpected error dropping table %s: %s", table, err)
+		}
+	}
+}
+
+// TestZeroDowntimeMigration exercises a full Start -> Complete cycle and
+// a full Start -> Rollback cycle, and confirms that UpAll and DownAll
+// leave zero-downtime migrations alone (see Migration.zeroDowntime).
+func TestZeroDowntimeMigration(t *testing.T) {
+	postgresUrl := postgresTestUrl()
+
+	raw, err := sql.Open("postgres", postgresUrl)
+	if err != nil {
+		t.Fatalf("unexpected error opening database: %s", err)
+	}
+	defer raw.Close()
+
+	versions := []int64{101, 102, 103}
+	tables := []string{"accounts"}
+	resetZeroDowntimeState(t, raw, versions, tables)
+	t.Cleanup(func() { resetZeroDowntimeState(t, raw, versions, tables) })
+
+	m := NewMigrator(postgresUrl)
+	m.Add(Migration{
+		Version: 101,
+		Name:    "accounts_init",
+		Up: `
+			create table accounts (
+				account_id integer primary key,
+				name text
+			);
+		`,
+		Down: `
+			drop table if exists accounts cascade;
+		`,
+	})
+	m.Add(Migration{
+		Version: 102,
+		Name:    "accounts_add_nickname",
+		Start: `
+			alter table accounts add column nickname text not null default '';
+		`,
+	})
+	m.Add(Migration{
+		Version: 103,
+		Name:    "accounts_add_favorite_color",
+		Start: `
+			alter table accounts add column favorite_color text;
+		`,
+		Rollback: `
+			alter table accounts drop column favorite_color;
+		`,
+	})
+
+	if err := m.UpAll(); err != nil {
+		t.Fatalf("unexpected error running UpAll: %s", err)
+	}
+	if v, err := m.LatestVersion(); err != nil {
+		t.Fatalf("unexpected error calling LatestVersion: %s", err)
+	} else if v != 101 {
+		t.Fatalf("expected UpAll to leave the zero-downtime migrations 102 and 103 unapplied, latest version is %d", v)
+	}
+
+	// Start -> Complete
+	if err := m.Start(102); err != nil {
+		t.Fatalf("unexpected error starting migration 102: %s", err)
+	}
+	if active, err := m.IsActiveMigrationPeriod(); err != nil {
+		t.Fatalf("unexpected error calling IsActiveMigrationPeriod: %s", err)
+	} else if !active {
+		t.Fatalf("expected a migration period to be active after Start")
+	}
+	if err := m.Start(103); err == nil {
+		t.Fatalf("expected Start to refuse a second migration while one is already active")
+	}
+	if err := m.Complete(); err != nil {
+		t.Fatalf("unexpected error completing migration 102: %s", err)
+	}
+	if active, err := m.IsActiveMigrationPeriod(); err != nil {
+		t.Fatalf("unexpected error calling IsActiveMigrationPeriod: %s", err)
+	} else if active {
+		t.Fatalf("expected no migration period to be active after Complete")
+	}
+	if v, err := m.LatestVersion(); err != nil {
+		t.Fatalf("unexpected error calling LatestVersion: %s", err)
+	} else if v != 102 {
+		t.Fatalf("expected Complete to record migration 102 as applied, latest version is %d", v)
+	}
+
+	// Start -> Rollback
+	if err := m.Start(103); err != nil {
+		t.Fatalf("unexpected error starting migration 103: %s", err)
+	}
+	if err := m.Rollback(); err != nil {
+		t.Fatalf("unexpected error rolling back migration 103: %s", err)
+	}
+	if active, err := m.IsActiveMigrationPeriod(); err != nil {
+		t.Fatalf("unexpected error calling IsActiveMigrationPeriod: %s", err)
+	} else if active {
+		t.Fatalf("expected no migration period to be active after Rollback")
+	}
+	if v, err := m.LatestVersion(); err != nil {
+		t.Fatalf("unexpected error calling LatestVersion: %s", err)
+	} else if v != 102 {
+		t.Fatalf("expected Rollback to leave migration 103 unapplied, latest version is %d", v)
+	}
+
+	// UpAll/DownAll must still ignore zero-downtime migrations even once
+	// one has been applied via Complete
+	if err := m.DownAll(); err != nil {
+		t.Fatalf("unexpected error running DownAll: %s", err)
+	}
+	if v, err := m.LatestVersion(); err != nil {
+		t.Fatalf("unexpected error calling LatestVersion: %s", err)
+	} else if v != 102 {
+		t.Fatalf("expected DownAll to leave the zero-downtime migration 102 applied, latest version is %d", v)
+	}
+}
+
+// TestForceAndRepair exercises the dirty/Force/Repair recovery path for a
+// non-transactional migration left dirty by a simulated crash partway
+// through.
+func TestForceAndRepair(t *testing.T) {
+	postgresUrl := postgresTestUrl()
+
+	raw, err := sql.Open("postgres", postgresUrl)
+	if err != nil {
+		t.Fatalf("unexpected error opening database: %s", err)
+	}
+	defer raw.Close()
+
+	versions := []int64{201, 202}
+	tables := []string{"gizmos"}
+	resetZeroDowntimeState(t, raw, versions, tables)
+	t.Cleanup(func() { resetZeroDowntimeState(t, raw, versions, tables) })
+
+	nonTransactional := false
+	m := NewMigrator(postgresUrl)
+	m.Add(Migration{
+		Version: 201,
+		Name:    "gizmos_init",
+		Up: `
+			create table gizmos (
+				gizmo_id integer primary key
+			);
+		`,
+		Down: `
+			drop table if exists gizmos;
+		`,
+		Transactional: &nonTransactional,
+	})
+
+	if err := m.UpOne(); err != nil {
+		t.Fatalf("unexpected error applying gizmos_init: %s", err)
+	}
+
+	// simulate a crash partway through a non-transactional migration
+	if _, err := raw.Exec(`update schema_migrations set dirty = true where version = 201`); err != nil {
+		t.Fatalf("unexpected error marking version 201 dirty: %s", err)
+	}
+
+	if err := m.UpAll(); err == nil {
+		t.Fatalf("expected UpAll to refuse to continue while version 201 is marked dirty")
+	}
+
+	if err := m.Repair(); err != nil {
+		t.Fatalf("unexpected error calling Repair: %s", err)
+	}
+	if err := m.UpAll(); err != nil {
+		t.Fatalf("unexpected error running UpAll after Repair: %s", err)
+	}
+
+	// Force records version 202 as applied without running its Up, as an
+	// operator would after confirming its change already took effect
+	m.Add(Migration{
+		Version: 202,
+		Name:    "gizmos_add_name",
+		Up: `
+			alter table gizmos add column name text;
+		`,
+		Down: `
+			alter table gizmos drop column name;
+		`,
+	})
+	if _, err := raw.Exec(`alter table gizmos add column name text;`); err != nil {
+		t.Fatalf("unexpected error applying gizmos_add_name out of band: %s", err)
+	}
+	if err := m.Force(202); err != nil {
+		t.Fatalf("unexpected error calling Force: %s", err)
+	}
+	if v, err := m.LatestVersion(); err != nil {
+		t.Fatalf("unexpected error calling LatestVersion: %s", err)
+	} else if v != 202 {
+		t.Fatalf("expected Force to record version 202 as applied, latest version is %d", v)
+	}
+}